@@ -0,0 +1,39 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FlattenSubsets flattens a set of EndpointSubsets down to the "ip:port" strings that older
+// callers (those not yet updated to understand named ports and multi-subset endpoints) expect.
+// It is a translation shim for use during the migration to the structured Subsets
+// representation and should be removed once all callers speak Subsets directly.
+func FlattenSubsets(subsets []EndpointSubset) []string {
+	result := make([]string, 0)
+	for _, subset := range subsets {
+		for _, port := range subset.Ports {
+			for _, addr := range subset.Addresses {
+				result = append(result, fmt.Sprintf("%s:%d", addr.IP, port.Port))
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
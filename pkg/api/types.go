@@ -0,0 +1,110 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package api contains the API types served by the master and consumed by
+// clients, controllers and proxies throughout the system.
+package api
+
+// TypeMeta is shared by all top level objects. The proper way to use it is to inline it in your type,
+// like this:
+// type MyAwesomeAPIObject struct {
+//      TypeMeta        `json:",inline" yaml:",inline"`
+//      ... // other fields
+// }
+type TypeMeta struct {
+	Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+}
+
+// ObjectMeta is metadata that all persisted resources must have.
+type ObjectMeta struct {
+	// Name is unique within a namespace.
+	Name string `json:"id,omitempty" yaml:"id,omitempty"`
+
+	// Namespace partitions the set of names so that names of unrelated objects
+	// (e.g. two different services) may collide. An unset Namespace is not filled in:
+	// the empty namespace is distinct from "default".
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// Annotations are unstructured key-value pairs that clients can use to store
+	// arbitrary metadata about an object, such as which system produced it.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// ObjectReference contains enough information to let you inspect or modify the referred object.
+type ObjectReference struct {
+	Kind      string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Name      string `json:"name,omitempty" yaml:"name,omitempty"`
+	UID       string `json:"uid,omitempty" yaml:"uid,omitempty"`
+}
+
+// Protocol defines the network protocols that are supported for an EndpointPort.
+type Protocol string
+
+const (
+	ProtocolTCP Protocol = "TCP"
+	ProtocolUDP Protocol = "UDP"
+)
+
+// Service is a named abstraction of software service (for example, mysql) consisting of a
+// Spec describing how to find and reach the Pods that back it.
+type Service struct {
+	TypeMeta   `json:",inline" yaml:",inline"`
+	ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	Spec ServiceSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+}
+
+// ServiceSpec describes the attributes that a user creates on a service.
+type ServiceSpec struct {
+	// Port is the TCP or UDP port that will be exposed by this service.
+	Port int `json:"port" yaml:"port"`
+}
+
+// Endpoints is a collection of endpoints that implement the actual service, grouped into
+// subsets that share the same set of ports.
+type Endpoints struct {
+	TypeMeta   `json:",inline" yaml:",inline"`
+	ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Subsets groups the addresses that offer the same set of ports. Every address in a
+	// given subset is expected to be reachable on every port in that subset.
+	Subsets []EndpointSubset `json:"subsets,omitempty" yaml:"subsets,omitempty"`
+}
+
+// EndpointSubset is a group of addresses with a common set of ports. The expanded set of
+// endpoints is the Cartesian product of Addresses x Ports.
+type EndpointSubset struct {
+	Addresses []EndpointAddress `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+	Ports     []EndpointPort    `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// EndpointAddress is a reachable address for a pod backing a service.
+type EndpointAddress struct {
+	IP string `json:"ip" yaml:"ip"`
+
+	// TargetRef, if set, identifies the object this address is backed by.
+	TargetRef *ObjectReference `json:"targetRef,omitempty" yaml:"targetRef,omitempty"`
+}
+
+// EndpointPort is a named port for a set of endpoints.
+type EndpointPort struct {
+	// Name distinguishes this port from the other ports of a multi-port service.
+	// ServiceSpec carries a single, unnamed Port, so Name is not matched against it.
+	Name     string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Port     int      `json:"port" yaml:"port"`
+	Protocol Protocol `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+}
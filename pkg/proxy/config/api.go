@@ -0,0 +1,163 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// EventType is the kind of change a watch delivered.
+type EventType int
+
+const (
+	// EventAdded indicates an object was created or updated.
+	EventAdded EventType = iota
+	// EventDeleted indicates an object was deleted.
+	EventDeleted
+)
+
+// ServiceEvent is a single watch delta for a service.
+type ServiceEvent struct {
+	Type    EventType
+	Service api.Service
+}
+
+// EndpointsEvent is a single watch delta for an endpoints object.
+type EndpointsEvent struct {
+	Type      EventType
+	Endpoints api.Endpoints
+}
+
+// APIClient is the minimal surface NewSourceAPI needs from an apiserver client: the
+// ability to list the current state and to watch for subsequent changes. A real
+// implementation backs this with a list+watch reflector against the apiserver; tests
+// back it with a fake.
+type APIClient interface {
+	ListServices() ([]api.Service, error)
+	WatchServices() (<-chan ServiceEvent, error)
+	ListEndpoints() ([]api.Endpoints, error)
+	WatchEndpoints() (<-chan EndpointsEvent, error)
+}
+
+// NewSourceAPI feeds servicesCh and endpointsCh from client, acting as a single
+// "source" analogous to the file/etcd/http sources: it translates the client's
+// list+watch protocol into ADD/REMOVE/SET operations. Every watch delta is sent on
+// as its own ADD or REMOVE. On startup, and again every resyncPeriod if any delta
+// arrived since the last resync, it relists and emits a single SET, so a storm of
+// watch events yields at most one full resync per resyncPeriod.
+func NewSourceAPI(client APIClient, resyncPeriod time.Duration, servicesCh chan<- ServiceUpdate, endpointsCh chan<- EndpointsUpdate) {
+	services, err := client.WatchServices()
+	if err != nil {
+		return
+	}
+	endpoints, err := client.WatchEndpoints()
+	if err != nil {
+		return
+	}
+
+	go runServiceReflector(client, resyncPeriod, services, servicesCh)
+	go runEndpointsReflector(client, resyncPeriod, endpoints, endpointsCh)
+}
+
+func runServiceReflector(client APIClient, resyncPeriod time.Duration, events <-chan ServiceEvent, out chan<- ServiceUpdate) {
+	relist := func() {
+		list, err := client.ListServices()
+		if err != nil {
+			return
+		}
+		out <- ServiceUpdate{Op: SET, Services: list}
+	}
+	relist()
+
+	var mu sync.Mutex
+	dirty := false
+
+	ticker := time.NewTicker(resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			mu.Lock()
+			dirty = true
+			mu.Unlock()
+			switch ev.Type {
+			case EventAdded:
+				out <- ServiceUpdate{Op: ADD, Services: []api.Service{ev.Service}}
+			case EventDeleted:
+				out <- ServiceUpdate{Op: REMOVE, Services: []api.Service{ev.Service}}
+			}
+		case <-ticker.C:
+			mu.Lock()
+			wasDirty := dirty
+			dirty = false
+			mu.Unlock()
+			if wasDirty {
+				relist()
+			}
+		}
+	}
+}
+
+func runEndpointsReflector(client APIClient, resyncPeriod time.Duration, events <-chan EndpointsEvent, out chan<- EndpointsUpdate) {
+	relist := func() {
+		list, err := client.ListEndpoints()
+		if err != nil {
+			return
+		}
+		out <- EndpointsUpdate{Op: SET, Endpoints: list}
+	}
+	relist()
+
+	var mu sync.Mutex
+	dirty := false
+
+	ticker := time.NewTicker(resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			mu.Lock()
+			dirty = true
+			mu.Unlock()
+			switch ev.Type {
+			case EventAdded:
+				out <- EndpointsUpdate{Op: ADD, Endpoints: []api.Endpoints{ev.Endpoints}}
+			case EventDeleted:
+				out <- EndpointsUpdate{Op: REMOVE, Endpoints: []api.Endpoints{ev.Endpoints}}
+			}
+		case <-ticker.C:
+			mu.Lock()
+			wasDirty := dirty
+			dirty = false
+			mu.Unlock()
+			if wasDirty {
+				relist()
+			}
+		}
+	}
+}
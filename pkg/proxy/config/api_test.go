@@ -0,0 +1,91 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	. "github.com/GoogleCloudPlatform/kubernetes/pkg/proxy/config"
+)
+
+// fakeAPIClient is a canned APIClient: List* return fixed snapshots, Watch* hand back
+// channels the test can push events on directly.
+type fakeAPIClient struct {
+	services        []api.Service
+	endpoints       []api.Endpoints
+	serviceEvents   chan ServiceEvent
+	endpointsEvents chan EndpointsEvent
+}
+
+func (f *fakeAPIClient) ListServices() ([]api.Service, error) { return f.services, nil }
+func (f *fakeAPIClient) WatchServices() (<-chan ServiceEvent, error) {
+	return f.serviceEvents, nil
+}
+func (f *fakeAPIClient) ListEndpoints() ([]api.Endpoints, error) { return f.endpoints, nil }
+func (f *fakeAPIClient) WatchEndpoints() (<-chan EndpointsEvent, error) {
+	return f.endpointsEvents, nil
+}
+
+func TestSourceAPIDeliversInitialList(t *testing.T) {
+	config := NewServiceConfig()
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+	endpointsConfig := NewEndpointsConfig()
+	endpointsHandler := NewEndpointsHandlerMock()
+	endpointsConfig.RegisterHandler(endpointsHandler)
+
+	client := &fakeAPIClient{
+		services:        []api.Service{{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}},
+		endpoints:       []api.Endpoints{{ObjectMeta: api.ObjectMeta{Name: "foo"}, Subsets: subsetsFor("1.2.3.4")}},
+		serviceEvents:   make(chan ServiceEvent),
+		endpointsEvents: make(chan EndpointsEvent),
+	}
+
+	handler.Wait(1)
+	endpointsHandler.Wait(1)
+	NewSourceAPI(client, time.Hour, config.Channel("api"), endpointsConfig.Channel("api"))
+	handler.ValidateServices(t, client.services)
+	endpointsHandler.ValidateEndpoints(t, client.endpoints)
+}
+
+func TestSourceAPIDeliversWatchDeltas(t *testing.T) {
+	config := NewServiceConfig()
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+	endpointsConfig := NewEndpointsConfig()
+
+	client := &fakeAPIClient{
+		serviceEvents:   make(chan ServiceEvent),
+		endpointsEvents: make(chan EndpointsEvent),
+	}
+
+	// Initial, empty relist.
+	handler.Wait(1)
+	NewSourceAPI(client, time.Hour, config.Channel("api"), endpointsConfig.Channel("api"))
+	handler.ValidateServices(t, []api.Service{})
+
+	foo := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+	handler.Wait(1)
+	client.serviceEvents <- ServiceEvent{Type: EventAdded, Service: foo}
+	handler.ValidateServices(t, []api.Service{foo})
+
+	handler.Wait(1)
+	client.serviceEvents <- ServiceEvent{Type: EventDeleted, Service: foo}
+	handler.ValidateServices(t, []api.Service{})
+}
@@ -0,0 +1,572 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config gathers service and endpoint configuration from one or more sources
+// (files, etcd, the apiserver, ...) and delivers a merged view of the world to any
+// registered handlers, typically a proxier.
+package config
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// defaultMinSyncPeriod is how long ServiceConfig and EndpointsConfig buffer incoming
+// updates before delivering a coalesced snapshot to handlers, absent a call to
+// SetSyncPeriod.
+const defaultMinSyncPeriod = 10 * time.Millisecond
+
+// Operation is the type of update being delivered on a config channel.
+type Operation int
+
+const (
+	// SET indicates that the update's contents should completely replace the
+	// previous state known for that source.
+	SET Operation = iota
+	// ADD indicates that the update's contents should be merged into the
+	// previous state known for that source.
+	ADD
+	// REMOVE indicates that the update's contents should be removed from the
+	// previous state known for that source.
+	REMOVE
+)
+
+// ServiceUpdate describes a change to make to the set of services known to a source.
+type ServiceUpdate struct {
+	Services []api.Service
+	Op       Operation
+}
+
+// EndpointsUpdate describes a change to make to the set of endpoints known to a source.
+type EndpointsUpdate struct {
+	Endpoints []api.Endpoints
+	Op        Operation
+}
+
+// ServiceHandler is notified with the complete, merged set of services whenever any
+// source changes.
+type ServiceHandler interface {
+	OnUpdate(services []api.Service)
+}
+
+// EndpointsHandler is notified with the complete, merged set of endpoints whenever any
+// source changes.
+type EndpointsHandler interface {
+	OnUpdate(endpoints []api.Endpoints)
+}
+
+// objectKey identifies an object across namespaces; names are only unique within a
+// namespace, so the two must be carried together wherever objects are merged or keyed.
+type objectKey struct {
+	namespace string
+	name      string
+}
+
+func keyOf(namespace, name string) objectKey {
+	return objectKey{namespace: namespace, name: name}
+}
+
+// less orders keys first by namespace, then by name, giving a deterministic, total order
+// across namespaces.
+func (k objectKey) less(other objectKey) bool {
+	if k.namespace != other.namespace {
+		return k.namespace < other.namespace
+	}
+	return k.name < other.name
+}
+
+// ServiceConfig merges service configuration from multiple sources and delivers the
+// combined result to every registered ServiceHandler.
+type ServiceConfig struct {
+	mux        sync.Mutex
+	channels   map[string]chan ServiceUpdate
+	services   map[string]map[objectKey]api.Service // source -> {namespace, name} -> Service
+	handlers   []ServiceHandler
+	nsHandlers []namespacedServiceHandler
+
+	syncMu        sync.Mutex
+	minSyncPeriod time.Duration
+	maxSyncPeriod time.Duration
+	syncPending   bool
+	syncFirstAt   time.Time
+	syncTimer     *time.Timer
+	syncEpoch     uint64
+
+	sourcePriority map[string]int
+}
+
+type namespacedServiceHandler struct {
+	namespace string
+	handler   ServiceHandler
+}
+
+// NewServiceConfig creates a new ServiceConfig with no sources or handlers registered.
+func NewServiceConfig() *ServiceConfig {
+	return &ServiceConfig{
+		channels:      make(map[string]chan ServiceUpdate),
+		services:      make(map[string]map[objectKey]api.Service),
+		minSyncPeriod: defaultMinSyncPeriod,
+	}
+}
+
+// SetSyncPeriod configures how updates are buffered before being delivered to
+// handlers: min is the debounce window restarted by every incoming update, and max
+// bounds how long a continuously-changing source can delay delivery. A min of zero
+// disables buffering: every update is delivered as soon as it is merged.
+func (c *ServiceConfig) SetSyncPeriod(min, max time.Duration) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	c.minSyncPeriod = min
+	c.maxSyncPeriod = max
+}
+
+// Sync immediately delivers any buffered state to registered handlers, bypassing the
+// debounce timer. Tests that want deterministic delivery instead of waiting out
+// MinSyncPeriod should call this after sending updates.
+func (c *ServiceConfig) Sync() {
+	c.syncMu.Lock()
+	if c.syncTimer != nil {
+		c.syncTimer.Stop()
+	}
+	c.syncPending = false
+	c.syncEpoch++ // invalidate any flush already in flight from the timer we just stopped
+	c.syncMu.Unlock()
+	c.notify()
+}
+
+// scheduleSync delivers the current state immediately if coalescing is disabled,
+// otherwise buffers it for up to minSyncPeriod (reset on every call, capped by
+// maxSyncPeriod) before flushing a single snapshot.
+func (c *ServiceConfig) scheduleSync() {
+	c.syncMu.Lock()
+	min := c.minSyncPeriod
+	if min <= 0 {
+		c.syncMu.Unlock()
+		c.notify()
+		return
+	}
+	now := time.Now()
+	if !c.syncPending {
+		c.syncPending = true
+		c.syncFirstAt = now
+		c.syncEpoch++
+		epoch := c.syncEpoch
+		c.syncTimer = time.AfterFunc(min, func() { c.flush(epoch) })
+		c.syncMu.Unlock()
+		return
+	}
+	if c.maxSyncPeriod > 0 && now.Sub(c.syncFirstAt) >= c.maxSyncPeriod {
+		// Already overdue: let the pending timer fire rather than pushing it out further.
+		c.syncMu.Unlock()
+		return
+	}
+	// time.Timer.Reset on an AfterFunc timer does not guarantee that a concurrently
+	// firing invocation of the old callback has finished or been cancelled, so start a
+	// fresh timer rather than resetting the existing one. flush uses syncEpoch to make
+	// sure a stale callback from a superseded timer is a no-op instead of delivering a
+	// second, racing notify.
+	c.syncTimer.Stop()
+	c.syncEpoch++
+	epoch := c.syncEpoch
+	c.syncTimer = time.AfterFunc(min, func() { c.flush(epoch) })
+	c.syncMu.Unlock()
+}
+
+func (c *ServiceConfig) flush(epoch uint64) {
+	c.syncMu.Lock()
+	if epoch != c.syncEpoch {
+		// Superseded by a Sync() or a later update; the timer that scheduled us no
+		// longer represents the pending state.
+		c.syncMu.Unlock()
+		return
+	}
+	c.syncPending = false
+	c.syncMu.Unlock()
+	c.notify()
+}
+
+// Channel returns a channel that a source named source should use to send updates. Calling
+// Channel more than once with the same source returns the same channel.
+func (c *ServiceConfig) Channel(source string) chan ServiceUpdate {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	channel, exists := c.channels[source]
+	if exists {
+		return channel
+	}
+	channel = make(chan ServiceUpdate)
+	c.channels[source] = channel
+	go c.listen(source, channel)
+	return channel
+}
+
+// RegisterHandler registers handler to be notified with the complete, merged set of
+// services, across all namespaces, whenever any source changes.
+func (c *ServiceConfig) RegisterHandler(handler ServiceHandler) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// RegisterHandlerForNamespace registers handler to be notified only of the services
+// belonging to ns, so a proxier that only cares about a single namespace need not churn
+// on updates to every other one.
+func (c *ServiceConfig) RegisterHandlerForNamespace(ns string, handler ServiceHandler) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.nsHandlers = append(c.nsHandlers, namespacedServiceHandler{namespace: ns, handler: handler})
+}
+
+// SetSourcePriority sets the priority used to resolve collisions when more than one
+// source reports a service for the same {namespace, name}: the source with the
+// highest priority wins. Sources default to priority 0, so local sources win over a
+// Federation source (registered at a negative priority) unless overridden here.
+func (c *ServiceConfig) SetSourcePriority(source string, priority int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.sourcePriority == nil {
+		c.sourcePriority = make(map[string]int)
+	}
+	c.sourcePriority[source] = priority
+}
+
+func (c *ServiceConfig) listen(source string, channel chan ServiceUpdate) {
+	for update := range channel {
+		c.merge(source, update)
+		c.scheduleSync()
+	}
+}
+
+func (c *ServiceConfig) merge(source string, update ServiceUpdate) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	services, exists := c.services[source]
+	if !exists {
+		services = make(map[objectKey]api.Service)
+	}
+	switch update.Op {
+	case ADD:
+		for _, service := range update.Services {
+			services[keyOf(service.Namespace, service.Name)] = service
+		}
+	case REMOVE:
+		for _, service := range update.Services {
+			delete(services, keyOf(service.Namespace, service.Name))
+		}
+	case SET:
+		services = make(map[objectKey]api.Service)
+		for _, service := range update.Services {
+			services[keyOf(service.Namespace, service.Name)] = service
+		}
+	}
+	c.services[source] = services
+}
+
+func (c *ServiceConfig) notify() {
+	c.mux.Lock()
+	winners := make(map[objectKey]prioritizedService)
+	for source, services := range c.services {
+		priority := c.sourcePriority[source]
+		for key, service := range services {
+			cur, exists := winners[key]
+			if !exists || priority > cur.priority || (priority == cur.priority && source < cur.source) {
+				winners[key] = prioritizedService{service: service, source: source, priority: priority}
+			}
+		}
+	}
+	byKey := make(map[objectKey]api.Service, len(winners))
+	for key, w := range winners {
+		byKey[key] = w.service
+	}
+	all := sortedServiceValues(byKey)
+	handlers := make([]ServiceHandler, len(c.handlers))
+	copy(handlers, c.handlers)
+	nsHandlers := make([]namespacedServiceHandler, len(c.nsHandlers))
+	copy(nsHandlers, c.nsHandlers)
+	c.mux.Unlock()
+
+	for _, handler := range handlers {
+		handler.OnUpdate(all)
+	}
+	for _, nh := range nsHandlers {
+		filtered := make([]api.Service, 0)
+		for _, service := range all {
+			if service.Namespace == nh.namespace {
+				filtered = append(filtered, service)
+			}
+		}
+		nh.handler.OnUpdate(filtered)
+	}
+}
+
+// prioritizedService tracks which source contributed the currently-winning value for
+// a key, so a later, lower-priority source doesn't clobber it during aggregation.
+type prioritizedService struct {
+	service  api.Service
+	source   string
+	priority int
+}
+
+func sortedServiceValues(byKey map[objectKey]api.Service) []api.Service {
+	keys := make([]objectKey, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	result := make([]api.Service, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, byKey[key])
+	}
+	return result
+}
+
+// EndpointsConfig merges endpoints configuration from multiple sources and delivers the
+// combined result to every registered EndpointsHandler.
+type EndpointsConfig struct {
+	mux        sync.Mutex
+	channels   map[string]chan EndpointsUpdate
+	endpoints  map[string]map[objectKey]api.Endpoints // source -> {namespace, name} -> Endpoints
+	handlers   []EndpointsHandler
+	nsHandlers []namespacedEndpointsHandler
+
+	syncMu        sync.Mutex
+	minSyncPeriod time.Duration
+	maxSyncPeriod time.Duration
+	syncPending   bool
+	syncFirstAt   time.Time
+	syncTimer     *time.Timer
+	syncEpoch     uint64
+
+	sourcePriority map[string]int
+}
+
+type namespacedEndpointsHandler struct {
+	namespace string
+	handler   EndpointsHandler
+}
+
+// NewEndpointsConfig creates a new EndpointsConfig with no sources or handlers registered.
+func NewEndpointsConfig() *EndpointsConfig {
+	return &EndpointsConfig{
+		channels:      make(map[string]chan EndpointsUpdate),
+		endpoints:     make(map[string]map[objectKey]api.Endpoints),
+		minSyncPeriod: defaultMinSyncPeriod,
+	}
+}
+
+// SetSyncPeriod configures how updates are buffered before being delivered to
+// handlers: min is the debounce window restarted by every incoming update, and max
+// bounds how long a continuously-changing source can delay delivery. A min of zero
+// disables buffering: every update is delivered as soon as it is merged.
+func (c *EndpointsConfig) SetSyncPeriod(min, max time.Duration) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	c.minSyncPeriod = min
+	c.maxSyncPeriod = max
+}
+
+// Sync immediately delivers any buffered state to registered handlers, bypassing the
+// debounce timer. Tests that want deterministic delivery instead of waiting out
+// MinSyncPeriod should call this after sending updates.
+func (c *EndpointsConfig) Sync() {
+	c.syncMu.Lock()
+	if c.syncTimer != nil {
+		c.syncTimer.Stop()
+	}
+	c.syncPending = false
+	c.syncEpoch++ // invalidate any flush already in flight from the timer we just stopped
+	c.syncMu.Unlock()
+	c.notify()
+}
+
+func (c *EndpointsConfig) scheduleSync() {
+	c.syncMu.Lock()
+	min := c.minSyncPeriod
+	if min <= 0 {
+		c.syncMu.Unlock()
+		c.notify()
+		return
+	}
+	now := time.Now()
+	if !c.syncPending {
+		c.syncPending = true
+		c.syncFirstAt = now
+		c.syncEpoch++
+		epoch := c.syncEpoch
+		c.syncTimer = time.AfterFunc(min, func() { c.flush(epoch) })
+		c.syncMu.Unlock()
+		return
+	}
+	if c.maxSyncPeriod > 0 && now.Sub(c.syncFirstAt) >= c.maxSyncPeriod {
+		c.syncMu.Unlock()
+		return
+	}
+	// See ServiceConfig.scheduleSync: avoid Reset on an AfterFunc timer, which doesn't
+	// guarantee a concurrently firing old callback has finished.
+	c.syncTimer.Stop()
+	c.syncEpoch++
+	epoch := c.syncEpoch
+	c.syncTimer = time.AfterFunc(min, func() { c.flush(epoch) })
+	c.syncMu.Unlock()
+}
+
+func (c *EndpointsConfig) flush(epoch uint64) {
+	c.syncMu.Lock()
+	if epoch != c.syncEpoch {
+		c.syncMu.Unlock()
+		return
+	}
+	c.syncPending = false
+	c.syncMu.Unlock()
+	c.notify()
+}
+
+// Channel returns a channel that a source named source should use to send updates. Calling
+// Channel more than once with the same source returns the same channel.
+func (c *EndpointsConfig) Channel(source string) chan EndpointsUpdate {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	channel, exists := c.channels[source]
+	if exists {
+		return channel
+	}
+	channel = make(chan EndpointsUpdate)
+	c.channels[source] = channel
+	go c.listen(source, channel)
+	return channel
+}
+
+// RegisterHandler registers handler to be notified with the complete, merged set of
+// endpoints, across all namespaces, whenever any source changes.
+func (c *EndpointsConfig) RegisterHandler(handler EndpointsHandler) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// RegisterHandlerForNamespace registers handler to be notified only of the endpoints
+// belonging to ns.
+func (c *EndpointsConfig) RegisterHandlerForNamespace(ns string, handler EndpointsHandler) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.nsHandlers = append(c.nsHandlers, namespacedEndpointsHandler{namespace: ns, handler: handler})
+}
+
+// SetSourcePriority sets the priority used to resolve collisions when more than one
+// source reports endpoints for the same {namespace, name}: the source with the
+// highest priority wins. Sources default to priority 0, so local sources win over a
+// Federation source (registered at a negative priority) unless overridden here.
+func (c *EndpointsConfig) SetSourcePriority(source string, priority int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.sourcePriority == nil {
+		c.sourcePriority = make(map[string]int)
+	}
+	c.sourcePriority[source] = priority
+}
+
+func (c *EndpointsConfig) listen(source string, channel chan EndpointsUpdate) {
+	for update := range channel {
+		c.merge(source, update)
+		c.scheduleSync()
+	}
+}
+
+func (c *EndpointsConfig) merge(source string, update EndpointsUpdate) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	endpoints, exists := c.endpoints[source]
+	if !exists {
+		endpoints = make(map[objectKey]api.Endpoints)
+	}
+	switch update.Op {
+	case ADD:
+		for _, e := range update.Endpoints {
+			endpoints[keyOf(e.Namespace, e.Name)] = e
+		}
+	case REMOVE:
+		for _, e := range update.Endpoints {
+			delete(endpoints, keyOf(e.Namespace, e.Name))
+		}
+	case SET:
+		endpoints = make(map[objectKey]api.Endpoints)
+		for _, e := range update.Endpoints {
+			endpoints[keyOf(e.Namespace, e.Name)] = e
+		}
+	}
+	c.endpoints[source] = endpoints
+}
+
+func (c *EndpointsConfig) notify() {
+	c.mux.Lock()
+	winners := make(map[objectKey]prioritizedEndpoints)
+	for source, endpoints := range c.endpoints {
+		priority := c.sourcePriority[source]
+		for key, e := range endpoints {
+			cur, exists := winners[key]
+			if !exists || priority > cur.priority || (priority == cur.priority && source < cur.source) {
+				winners[key] = prioritizedEndpoints{endpoints: e, source: source, priority: priority}
+			}
+		}
+	}
+	byKey := make(map[objectKey]api.Endpoints, len(winners))
+	for key, w := range winners {
+		byKey[key] = w.endpoints
+	}
+	all := sortedEndpointsValues(byKey)
+	handlers := make([]EndpointsHandler, len(c.handlers))
+	copy(handlers, c.handlers)
+	nsHandlers := make([]namespacedEndpointsHandler, len(c.nsHandlers))
+	copy(nsHandlers, c.nsHandlers)
+	c.mux.Unlock()
+
+	for _, handler := range handlers {
+		handler.OnUpdate(all)
+	}
+	for _, nh := range nsHandlers {
+		filtered := make([]api.Endpoints, 0)
+		for _, e := range all {
+			if e.Namespace == nh.namespace {
+				filtered = append(filtered, e)
+			}
+		}
+		nh.handler.OnUpdate(filtered)
+	}
+}
+
+// prioritizedEndpoints tracks which source contributed the currently-winning value
+// for a key, so a later, lower-priority source doesn't clobber it during aggregation.
+type prioritizedEndpoints struct {
+	endpoints api.Endpoints
+	source    string
+	priority  int
+}
+
+func sortedEndpointsValues(byKey map[objectKey]api.Endpoints) []api.Endpoints {
+	keys := make([]objectKey, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	result := make([]api.Endpoints, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, byKey[key])
+	}
+	return result
+}
@@ -21,6 +21,7 @@ import (
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	. "github.com/GoogleCloudPlatform/kubernetes/pkg/proxy/config"
@@ -45,6 +46,9 @@ func (s sortedServices) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 func (s sortedServices) Less(i, j int) bool {
+	if s[i].Namespace != s[j].Namespace {
+		return s[i].Namespace < s[j].Namespace
+	}
 	return s[i].Name < s[j].Name
 }
 
@@ -83,6 +87,9 @@ func (s sortedEndpoints) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 func (s sortedEndpoints) Less(i, j int) bool {
+	if s[i].Namespace != s[j].Namespace {
+		return s[i].Namespace < s[j].Namespace
+	}
 	return s[i].Name < s[j].Name
 }
 
@@ -121,6 +128,20 @@ func CreateServiceUpdate(op Operation, services ...api.Service) ServiceUpdate {
 	return ret
 }
 
+// subsetsFor builds a single EndpointSubset whose addresses carry the given IPs, one port
+// named "http" per subset. It exists to keep the endpoints fixtures in this file terse now
+// that Endpoints carries structured Subsets instead of flat "ip:port" strings.
+func subsetsFor(ips ...string) []api.EndpointSubset {
+	addresses := make([]api.EndpointAddress, len(ips))
+	for i, ip := range ips {
+		addresses[i] = api.EndpointAddress{IP: ip}
+	}
+	return []api.EndpointSubset{{
+		Addresses: addresses,
+		Ports:     []api.EndpointPort{{Name: "http", Port: 80, Protocol: api.ProtocolTCP}},
+	}}
+}
+
 func CreateEndpointsUpdate(op Operation, endpoints ...api.Endpoints) EndpointsUpdate {
 	ret := EndpointsUpdate{Op: op}
 	ret.Endpoints = make([]api.Endpoints, len(endpoints))
@@ -171,8 +192,49 @@ func TestServiceAddedRemovedSetAndNotified(t *testing.T) {
 	handler.ValidateServices(t, services)
 }
 
+func TestServiceAddedDuplicateNamesAcrossNamespacesAndNotified(t *testing.T) {
+	config := NewServiceConfig()
+	channel := config.Channel("one")
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+
+	fooDefault := api.Service{ObjectMeta: api.ObjectMeta{Namespace: "default", Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+	fooOther := api.Service{ObjectMeta: api.ObjectMeta{Namespace: "other", Name: "foo"}, Spec: api.ServiceSpec{Port: 20}}
+
+	handler.Wait(1)
+	channel <- CreateServiceUpdate(ADD, fooDefault)
+	handler.ValidateServices(t, []api.Service{fooDefault})
+
+	handler.Wait(1)
+	channel <- CreateServiceUpdate(ADD, fooOther)
+	handler.ValidateServices(t, []api.Service{fooDefault, fooOther})
+
+	handler.Wait(1)
+	channel <- CreateServiceUpdate(REMOVE, api.Service{ObjectMeta: api.ObjectMeta{Namespace: "default", Name: "foo"}})
+	handler.ValidateServices(t, []api.Service{fooOther})
+}
+
+func TestRegisterHandlerForNamespaceOnlyReceivesThatNamespace(t *testing.T) {
+	config := NewServiceConfig()
+	channel := config.Channel("one")
+	defaultHandler := NewServiceHandlerMock()
+	otherHandler := NewServiceHandlerMock()
+	config.RegisterHandlerForNamespace("default", defaultHandler)
+	config.RegisterHandlerForNamespace("other", otherHandler)
+
+	fooDefault := api.Service{ObjectMeta: api.ObjectMeta{Namespace: "default", Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+	fooOther := api.Service{ObjectMeta: api.ObjectMeta{Namespace: "other", Name: "foo"}, Spec: api.ServiceSpec{Port: 20}}
+
+	defaultHandler.Wait(1)
+	otherHandler.Wait(1)
+	channel <- CreateServiceUpdate(ADD, fooDefault, fooOther)
+	defaultHandler.ValidateServices(t, []api.Service{fooDefault})
+	otherHandler.ValidateServices(t, []api.Service{fooOther})
+}
+
 func TestNewMultipleSourcesServicesAddedAndNotified(t *testing.T) {
 	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
 	channelOne := config.Channel("one")
 	channelTwo := config.Channel("two")
 	if channelOne == channelTwo {
@@ -182,15 +244,21 @@ func TestNewMultipleSourcesServicesAddedAndNotified(t *testing.T) {
 	config.RegisterHandler(handler)
 	serviceUpdate1 := CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}})
 	serviceUpdate2 := CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "bar"}, Spec: api.ServiceSpec{Port: 20}})
-	handler.Wait(2)
+	// Don't rely on both sends landing in the same MinSyncPeriod debounce window: force
+	// delivery with Sync once both have had a chance to merge, so there's exactly one
+	// OnUpdate regardless of scheduling.
+	handler.Wait(1)
 	channelOne <- serviceUpdate1
 	channelTwo <- serviceUpdate2
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
 	services := []api.Service{serviceUpdate2.Services[0], serviceUpdate1.Services[0]}
 	handler.ValidateServices(t, services)
 }
 
 func TestNewMultipleSourcesServicesMultipleHandlersAddedAndNotified(t *testing.T) {
 	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
 	channelOne := config.Channel("one")
 	channelTwo := config.Channel("two")
 	handler := NewServiceHandlerMock()
@@ -199,10 +267,12 @@ func TestNewMultipleSourcesServicesMultipleHandlersAddedAndNotified(t *testing.T
 	config.RegisterHandler(handler2)
 	serviceUpdate1 := CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}})
 	serviceUpdate2 := CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "bar"}, Spec: api.ServiceSpec{Port: 20}})
-	handler.Wait(2)
-	handler2.Wait(2)
+	handler.Wait(1)
+	handler2.Wait(1)
 	channelOne <- serviceUpdate1
 	channelTwo <- serviceUpdate2
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
 	services := []api.Service{serviceUpdate2.Services[0], serviceUpdate1.Services[0]}
 	handler.ValidateServices(t, services)
 	handler2.ValidateServices(t, services)
@@ -210,6 +280,7 @@ func TestNewMultipleSourcesServicesMultipleHandlersAddedAndNotified(t *testing.T
 
 func TestNewMultipleSourcesEndpointsMultipleHandlersAddedAndNotified(t *testing.T) {
 	config := NewEndpointsConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
 	channelOne := config.Channel("one")
 	channelTwo := config.Channel("two")
 	handler := NewEndpointsHandlerMock()
@@ -218,16 +289,21 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddedAndNotified(t *testing.
 	config.RegisterHandler(handler2)
 	endpointsUpdate1 := CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "foo"},
-		Endpoints:  []string{"endpoint1", "endpoint2"},
+		Subsets:    subsetsFor("endpoint1", "endpoint2"),
 	})
 	endpointsUpdate2 := CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "bar"},
-		Endpoints:  []string{"endpoint3", "endpoint4"},
+		Subsets:    subsetsFor("endpoint3", "endpoint4"),
 	})
-	handler.Wait(2)
-	handler2.Wait(2)
+	// Don't rely on both sends landing in the same MinSyncPeriod debounce window: force
+	// delivery with Sync once both have had a chance to merge, so there's exactly one
+	// OnUpdate regardless of scheduling.
+	handler.Wait(1)
+	handler2.Wait(1)
 	channelOne <- endpointsUpdate1
 	channelTwo <- endpointsUpdate2
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
 
 	endpoints := []api.Endpoints{endpointsUpdate2.Endpoints[0], endpointsUpdate1.Endpoints[0]}
 	handler.ValidateEndpoints(t, endpoints)
@@ -244,16 +320,24 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddRemoveSetAndNotified(t *t
 	config.RegisterHandler(handler2)
 	endpointsUpdate1 := CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "foo"},
-		Endpoints:  []string{"endpoint1", "endpoint2"},
+		Subsets:    subsetsFor("endpoint1", "endpoint2"),
 	})
 	endpointsUpdate2 := CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "bar"},
-		Endpoints:  []string{"endpoint3", "endpoint4"},
+		Subsets:    subsetsFor("endpoint3", "endpoint4"),
 	})
-	handler.Wait(2)
-	handler2.Wait(2)
+	// Don't rely on both sends landing in the same MinSyncPeriod debounce window: force
+	// delivery with Sync once both have had a chance to merge, so there's exactly one
+	// OnUpdate regardless of scheduling.
+	handler.Wait(1)
+	handler2.Wait(1)
 	channelOne <- endpointsUpdate1
 	channelTwo <- endpointsUpdate2
+	// Sleep well under the default MinSyncPeriod so the Sync below (not the debounce
+	// timer) is what delivers, while still giving both listener goroutines a chance to
+	// merge first.
+	time.Sleep(2 * time.Millisecond)
+	config.Sync()
 
 	endpoints := []api.Endpoints{endpointsUpdate2.Endpoints[0], endpointsUpdate1.Endpoints[0]}
 	handler.ValidateEndpoints(t, endpoints)
@@ -262,7 +346,7 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddRemoveSetAndNotified(t *t
 	// Add one more
 	endpointsUpdate3 := CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "foobar"},
-		Endpoints:  []string{"endpoint5", "endpoint6"},
+		Subsets:    subsetsFor("endpoint5", "endpoint6"),
 	})
 	handler.Wait(1)
 	handler2.Wait(1)
@@ -274,7 +358,7 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddRemoveSetAndNotified(t *t
 	// Update the "foo" service with new endpoints
 	endpointsUpdate1 = CreateEndpointsUpdate(ADD, api.Endpoints{
 		ObjectMeta: api.ObjectMeta{Name: "foo"},
-		Endpoints:  []string{"endpoint77"},
+		Subsets:    subsetsFor("endpoint77"),
 	})
 	handler.Wait(1)
 	handler2.Wait(1)
@@ -293,3 +377,44 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddRemoveSetAndNotified(t *t
 	handler.ValidateEndpoints(t, endpoints)
 	handler2.ValidateEndpoints(t, endpoints)
 }
+
+func TestServiceConfigSyncForcesImmediateDelivery(t *testing.T) {
+	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only an explicit Sync delivers in time
+	channel := config.Channel("one")
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+
+	handler.Wait(1)
+	channel <- CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}})
+	// Give the listener goroutine a moment to merge before forcing the flush.
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
+	handler.ValidateServices(t, []api.Service{{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}})
+}
+
+func TestServiceConfigZeroSyncPeriodDeliversImmediately(t *testing.T) {
+	config := NewServiceConfig()
+	config.SetSyncPeriod(0, 0)
+	channel := config.Channel("one")
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+
+	handler.Wait(1)
+	channel <- CreateServiceUpdate(ADD, api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}})
+	handler.ValidateServices(t, []api.Service{{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}})
+}
+
+func TestFlattenSubsets(t *testing.T) {
+	subsets := []api.EndpointSubset{
+		{
+			Addresses: []api.EndpointAddress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}},
+			Ports:     []api.EndpointPort{{Name: "http", Port: 80, Protocol: api.ProtocolTCP}},
+		},
+	}
+	expected := []string{"1.2.3.4:80", "5.6.7.8:80"}
+	got := api.FlattenSubsets(subsets)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %#v, Got %#v", expected, got)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// FederationSourceName is the source name FederationSource registers its channels
+// under, and the name SetSourcePriority should be called with to override its
+// default precedence against local sources.
+const FederationSourceName = "federation"
+
+// OriginClusterAnnotation is set on every api.Service and api.Endpoints a
+// FederationSource injects, naming the remote cluster the object was imported from.
+const OriginClusterAnnotation = "federation.alpha.kubernetes.io/origin-cluster"
+
+// ImportedService describes a service exported by a remote cluster in a federation,
+// together with the endpoints it currently resolves to in that remote cluster.
+type ImportedService struct {
+	Name          string
+	Namespace     string
+	RemoteCluster string
+	// RemoteEndpoints are "ip:port" pairs reachable in the remote cluster.
+	RemoteEndpoints []string
+}
+
+// FederationSource turns ImportedService records into ordinary api.Service and
+// api.Endpoints objects, tagged with OriginClusterAnnotation, and feeds them into a
+// ServiceConfig/EndpointsConfig merge pipeline as just another source. By default it
+// registers itself at a lower priority than local sources, so that a locally-defined
+// service of the same name always wins; call SetSourcePriority on the underlying
+// configs to change that.
+type FederationSource struct {
+	services  chan<- ServiceUpdate
+	endpoints chan<- EndpointsUpdate
+}
+
+// NewFederationSource registers a "federation" channel with serviceConfig and
+// endpointsConfig, sets its priority below the default so local sources win on
+// conflicting names, and returns a FederationSource ready to Import records through it.
+func NewFederationSource(serviceConfig *ServiceConfig, endpointsConfig *EndpointsConfig) *FederationSource {
+	services := serviceConfig.Channel(FederationSourceName)
+	endpoints := endpointsConfig.Channel(FederationSourceName)
+	serviceConfig.SetSourcePriority(FederationSourceName, -1)
+	endpointsConfig.SetSourcePriority(FederationSourceName, -1)
+	return &FederationSource{services: services, endpoints: endpoints}
+}
+
+// Import injects imported as an ADD, tagging both the service and its endpoints with
+// the remote cluster they came from.
+func (f *FederationSource) Import(imported ImportedService) {
+	annotations := map[string]string{OriginClusterAnnotation: imported.RemoteCluster}
+
+	f.services <- ServiceUpdate{Op: ADD, Services: []api.Service{{
+		ObjectMeta: api.ObjectMeta{
+			Namespace:   imported.Namespace,
+			Name:        imported.Name,
+			Annotations: annotations,
+		},
+	}}}
+
+	f.endpoints <- EndpointsUpdate{Op: ADD, Endpoints: []api.Endpoints{{
+		ObjectMeta: api.ObjectMeta{
+			Namespace:   imported.Namespace,
+			Name:        imported.Name,
+			Annotations: annotations,
+		},
+		Subsets: subsetsForRemoteEndpoints(imported.RemoteEndpoints),
+	}}}
+}
+
+// subsetsForRemoteEndpoints parses "ip:port" pairs into EndpointSubsets, grouping
+// addresses that share a port into the same subset so Addresses x Ports in each
+// subset still expands to exactly the pairs given. Entries that aren't valid
+// "ip:port" pairs are skipped.
+func subsetsForRemoteEndpoints(remoteEndpoints []string) []api.EndpointSubset {
+	addressesByPort := make(map[int][]api.EndpointAddress)
+	var ports []int
+	for _, remote := range remoteEndpoints {
+		host, portStr, err := net.SplitHostPort(remote)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+		if _, exists := addressesByPort[port]; !exists {
+			ports = append(ports, port)
+		}
+		addressesByPort[port] = append(addressesByPort[port], api.EndpointAddress{IP: host})
+	}
+	subsets := make([]api.EndpointSubset, 0, len(ports))
+	for _, port := range ports {
+		subsets = append(subsets, api.EndpointSubset{
+			Addresses: addressesByPort[port],
+			Ports:     []api.EndpointPort{{Port: port}},
+		})
+	}
+	return subsets
+}
+
+// Remove withdraws a previously imported service, identified by namespace and name.
+func (f *FederationSource) Remove(namespace, name string) {
+	meta := api.ObjectMeta{Namespace: namespace, Name: name}
+	f.services <- ServiceUpdate{Op: REMOVE, Services: []api.Service{{ObjectMeta: meta}}}
+	f.endpoints <- EndpointsUpdate{Op: REMOVE, Endpoints: []api.Endpoints{{ObjectMeta: meta}}}
+}
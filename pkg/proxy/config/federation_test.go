@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	. "github.com/GoogleCloudPlatform/kubernetes/pkg/proxy/config"
+)
+
+func TestNewMultipleSourcesServicesLocalAndFederationConflictingNames(t *testing.T) {
+	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
+	channelOne := config.Channel("one")
+	channelTwo := config.Channel(FederationSourceName)
+	config.SetSourcePriority(FederationSourceName, -1)
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+
+	local := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+	remote := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo", Annotations: map[string]string{OriginClusterAnnotation: "remote-1"}}}
+	bar := api.Service{ObjectMeta: api.ObjectMeta{Name: "bar"}, Spec: api.ServiceSpec{Port: 20}}
+
+	// Don't rely on both sends landing in the same MinSyncPeriod debounce window: force
+	// delivery with Sync once both have had a chance to merge. Local should win the
+	// conflicting "foo" name because the Federation source defaults to a lower
+	// priority than any local source.
+	handler.Wait(1)
+	channelOne <- CreateServiceUpdate(ADD, local)
+	channelTwo <- CreateServiceUpdate(ADD, remote, bar)
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
+	handler.ValidateServices(t, []api.Service{bar, local})
+}
+
+func TestFederationSourceLocalWinsByDefault(t *testing.T) {
+	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
+	channelOne := config.Channel("one")
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+	federation := NewFederationSource(config, NewEndpointsConfig())
+
+	local := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+
+	// Don't rely on the local send and the federation Import landing in the same
+	// MinSyncPeriod debounce window: force delivery with Sync once both have had a
+	// chance to merge.
+	handler.Wait(1)
+	channelOne <- CreateServiceUpdate(ADD, local)
+	federation.Import(ImportedService{Name: "foo", RemoteCluster: "remote-1", RemoteEndpoints: []string{"9.9.9.9:80"}})
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
+	handler.ValidateServices(t, []api.Service{local})
+}
+
+func TestFederationSourceWinsWhenPriorityOverridden(t *testing.T) {
+	config := NewServiceConfig()
+	config.SetSyncPeriod(time.Hour, 0) // long enough that only the explicit Sync below delivers
+	channelOne := config.Channel("one")
+	handler := NewServiceHandlerMock()
+	config.RegisterHandler(handler)
+	federation := NewFederationSource(config, NewEndpointsConfig())
+	config.SetSourcePriority(FederationSourceName, 10)
+
+	local := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo"}, Spec: api.ServiceSpec{Port: 10}}
+	remote := api.Service{ObjectMeta: api.ObjectMeta{Name: "foo", Annotations: map[string]string{OriginClusterAnnotation: "remote-1"}}}
+
+	// Don't rely on the local send and the federation Import landing in the same
+	// MinSyncPeriod debounce window: force delivery with Sync once both have had a
+	// chance to merge.
+	handler.Wait(1)
+	channelOne <- CreateServiceUpdate(ADD, local)
+	federation.Import(ImportedService{Name: "foo", RemoteCluster: "remote-1", RemoteEndpoints: []string{"9.9.9.9:80"}})
+	time.Sleep(10 * time.Millisecond)
+	config.Sync()
+	handler.ValidateServices(t, []api.Service{remote})
+}
+
+func TestFederationSourceImportDeliversParsedEndpoints(t *testing.T) {
+	endpointsConfig := NewEndpointsConfig()
+	handler := NewEndpointsHandlerMock()
+	endpointsConfig.RegisterHandler(handler)
+	federation := NewFederationSource(NewServiceConfig(), endpointsConfig)
+
+	handler.Wait(1)
+	federation.Import(ImportedService{
+		Name:          "foo",
+		RemoteCluster: "remote-1",
+		RemoteEndpoints: []string{
+			"9.9.9.9:80",
+			"8.8.8.8:80",
+			"9.9.9.9:443",
+		},
+	})
+
+	handler.updated.Wait()
+	if len(handler.endpoints) != 1 {
+		t.Fatalf("Expected one Endpoints object, got %#v", handler.endpoints)
+	}
+	got := handler.endpoints[0]
+	if got.Annotations[OriginClusterAnnotation] != "remote-1" {
+		t.Errorf("Expected origin cluster annotation, got %#v", got.Annotations)
+	}
+	flattened := api.FlattenSubsets(got.Subsets)
+	expected := []string{"8.8.8.8:80", "9.9.9.9:443", "9.9.9.9:80"}
+	if !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("Expected %#v, Got %#v", expected, flattened)
+	}
+}